@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+// IdentityProvider authenticates a bearer token presented in the
+// Authorization header and reports the claims it carries. Implementations
+// typically verify a JWT ID token issued by an OAuth2/OIDC provider such as
+// Google or GitHub.
+type IdentityProvider interface {
+	// Name identifies the provider, for logging and error messages.
+	Name() string
+
+	// Verify checks the bearer token's signature and expiry and returns
+	// the claims it carries. Mapping the claims to an Upspin user name is
+	// done separately, by Config.MapIdentity.
+	Verify(token string) (*IdentityClaims, error)
+}
+
+// IdentityClaims holds the subset of OIDC claims Upspin cares about.
+type IdentityClaims struct {
+	// Issuer is the "iss" claim.
+	Issuer string
+
+	// Subject is the "sub" claim, stable and unique within Issuer.
+	Subject string
+
+	// Email is the "email" claim, if present.
+	Email string
+
+	// EmailVerified is the "email_verified" claim. Most OIDC providers let
+	// a caller-controlled or unverified email end up in the Email claim,
+	// so defaultMapIdentity refuses to trust Email unless this is true.
+	EmailVerified bool
+
+	// Expiry is the time at which the token stops being valid ("exp" claim).
+	Expiry time.Time
+}
+
+// MapIdentityFunc resolves verified identity claims to an Upspin user name.
+// The default, used when Config.MapIdentity is nil, requires a *verified*
+// email claim and uses it verbatim as the user name.
+type MapIdentityFunc func(provider string, claims *IdentityClaims) (upspin.UserName, error)
+
+func defaultMapIdentity(provider string, claims *IdentityClaims) (upspin.UserName, error) {
+	if claims.Email == "" {
+		return "", fmt.Errorf("auth: %s token has no email claim to map to an Upspin user name", provider)
+	}
+	if !claims.EmailVerified {
+		return "", fmt.Errorf("auth: %s token's email claim %q is not verified", provider, claims.Email)
+	}
+	return upspin.UserName(claims.Email), nil
+}
+
+// bearerToken extracts the token from a standard "Authorization: Bearer
+// <token>" header, returning "" if the header is absent or malformed.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(auth, prefix)
+}
+
+// doAuthWithIdentityProviders authenticates r using the first of
+// ah.config.Providers that accepts the bearer token. doAuth calls this when
+// the request carries no signatureHeader.
+func (ah *authHandler) doAuthWithIdentityProviders(r *http.Request) (*sessionImpl, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, errors.New("auth: no bearer token in Authorization header")
+	}
+	if session := ah.getSessionByTokenHash(token); session != nil {
+		return session, nil
+	}
+	if len(ah.config.Providers) == 0 {
+		return nil, errors.New("auth: no identity providers configured")
+	}
+	var lastErr error
+	for _, p := range ah.config.Providers {
+		claims, err := p.Verify(token)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		mapIdentity := ah.config.MapIdentity
+		if mapIdentity == nil {
+			mapIdentity = defaultMapIdentity
+		}
+		user, err := mapIdentity(p.Name(), claims)
+		if err != nil {
+			return nil, err
+		}
+		session := &sessionImpl{
+			isAuth: true,
+			user:   user,
+		}
+		ah.setSessionByTokenHash(token, session, claims.Expiry)
+		return session, nil
+	}
+	return nil, fmt.Errorf("auth: no identity provider accepted the bearer token: %v", lastErr)
+}
+
+// tokenHash returns a fixed-size, non-reversible key so the session cache
+// never stores raw bearer tokens.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (ah *authHandler) getSessionByTokenHash(token string) *sessionImpl {
+	session, ok := ah.sessionCache.Get(tokenHash(token))
+	if !ok {
+		return nil
+	}
+	return session.(*sessionImpl)
+}
+
+// setSessionByTokenHash caches session under the token's hash with a TTL
+// matching the token's remaining lifetime, so a cached session never outlives
+// the token's own "exp" claim and a replayed, expired token is rejected
+// (falling through to a fresh p.Verify call) rather than served from cache.
+func (ah *authHandler) setSessionByTokenHash(token string, session *sessionImpl, expiry time.Time) {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return
+	}
+	ah.sessionCache.Add(tokenHash(token), session, ttl)
+}
+
+// OIDCProvider verifies RS256-signed OIDC ID tokens issued by a single
+// issuer (for example Google or GitHub's token service), using public keys
+// obtained from the issuer's JWKS endpoint.
+type OIDCProvider struct {
+	// IssuerName is a short label such as "google" or "github", used by Name.
+	IssuerName string
+
+	// Issuer is the expected "iss" claim, e.g. "https://accounts.google.com".
+	Issuer string
+
+	// Audience is the expected "aud" claim, typically the OAuth2 client ID.
+	Audience string
+
+	// Keys returns the issuer's current signing keys, keyed by "kid".
+	// Callers typically implement this with a JWKS fetcher that refreshes
+	// on a cache-control-driven interval.
+	Keys func() (map[string]*rsa.PublicKey, error)
+}
+
+var _ IdentityProvider = (*OIDCProvider)(nil)
+
+// Name implements IdentityProvider.
+func (p *OIDCProvider) Name() string {
+	return p.IssuerName
+}
+
+// Verify implements IdentityProvider by checking the token's RS256
+// signature and its iss/aud/exp claims.
+func (p *OIDCProvider) Verify(token string) (*IdentityClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("auth: %s: malformed JWT", p.IssuerName)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTJSON(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("auth: %s: bad header: %v", p.IssuerName, err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("auth: %s: unsupported alg %q", p.IssuerName, header.Alg)
+	}
+	keys, err := p.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("auth: %s: fetching signing keys: %v", p.IssuerName, err)
+	}
+	key, ok := keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("auth: %s: unknown signing key %q", p.IssuerName, header.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("auth: %s: bad signature encoding: %v", p.IssuerName, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("auth: %s: signature verification failed: %v", p.IssuerName, err)
+	}
+	var claims struct {
+		Iss           string `json:"iss"`
+		Aud           string `json:"aud"`
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Exp           int64  `json:"exp"`
+	}
+	if err := decodeJWTJSON(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("auth: %s: bad payload: %v", p.IssuerName, err)
+	}
+	if claims.Iss != p.Issuer {
+		return nil, fmt.Errorf("auth: %s: unexpected issuer %q", p.IssuerName, claims.Iss)
+	}
+	if claims.Aud != p.Audience {
+		return nil, fmt.Errorf("auth: %s: unexpected audience %q", p.IssuerName, claims.Aud)
+	}
+	expiry := time.Unix(claims.Exp, 0)
+	if time.Now().After(expiry) {
+		return nil, fmt.Errorf("auth: %s: token expired at %v", p.IssuerName, expiry)
+	}
+	return &IdentityClaims{
+		Issuer:        claims.Iss,
+		Subject:       claims.Sub,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Expiry:        expiry,
+	}, nil
+}
+
+// decodeJWTJSON base64url-decodes a JWT segment and unmarshals it as JSON.
+func decodeJWTJSON(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+func TestDefaultMapIdentityRejectsUnverifiedEmail(t *testing.T) {
+	_, err := defaultMapIdentity("test", &IdentityClaims{Email: "user@example.com"})
+	if err == nil {
+		t.Fatal("expected error for unverified email")
+	}
+}
+
+func TestDefaultMapIdentityAcceptsVerifiedEmail(t *testing.T) {
+	user, err := defaultMapIdentity("test", &IdentityClaims{Email: "user@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user != upspin.UserName("user@example.com") {
+		t.Fatalf("got %q, want user@example.com", user)
+	}
+}
+
+func TestDefaultMapIdentityRejectsMissingEmail(t *testing.T) {
+	if _, err := defaultMapIdentity("test", &IdentityClaims{EmailVerified: true}); err == nil {
+		t.Fatal("expected error for missing email claim")
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer abc.def.ghi")
+	if got := bearerToken(req); got != "abc.def.ghi" {
+		t.Fatalf("got %q, want abc.def.ghi", got)
+	}
+}
+
+func TestBearerTokenIgnoresOtherSchemes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if got := bearerToken(req); got != "" {
+		t.Fatalf("got %q, want empty for a non-Bearer Authorization header", got)
+	}
+}
+
+func TestBearerTokenMissingHeader(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if got := bearerToken(req); got != "" {
+		t.Fatalf("got %q, want empty when Authorization header is absent", got)
+	}
+}
+
+// TestCachedIdentitySessionExpiresWithToken guards against a prior bug
+// where a session cached by setSessionByTokenHash outlived the token's own
+// "exp" claim: a long-expired bearer token, replayed well after its expiry,
+// would still hit the cache in getSessionByTokenHash and be treated as
+// authenticated, without ever being re-verified or its expiry checked.
+func TestCachedIdentitySessionExpiresWithToken(t *testing.T) {
+	ah := newTestHandler(t, nil)
+	session := &sessionImpl{isAuth: true, user: "user@example.com"}
+
+	ah.setSessionByTokenHash("a-token", session, time.Now().Add(10*time.Millisecond))
+	if got := ah.getSessionByTokenHash("a-token"); got == nil {
+		t.Fatal("expected the session to be cached before the token's expiry")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if got := ah.getSessionByTokenHash("a-token"); got != nil {
+		t.Fatal("expected the cached session to be gone once the token's expiry has passed")
+	}
+}
+
+func TestSetSessionByTokenHashDoesNotCacheAlreadyExpiredToken(t *testing.T) {
+	ah := newTestHandler(t, nil)
+	session := &sessionImpl{isAuth: true, user: "user@example.com"}
+
+	ah.setSessionByTokenHash("a-token", session, time.Now().Add(-time.Minute))
+	if got := ah.getSessionByTokenHash("a-token"); got != nil {
+		t.Fatal("expected a token that was already expired at caching time to never be served from cache")
+	}
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/cache"
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+// defaultMaxAuthFailures and defaultLockoutBase are used when the
+// corresponding Config fields are zero; see Config.MaxAuthFailures.
+const (
+	defaultMaxAuthFailures = 5
+	defaultLockoutBase     = 1 * time.Second
+)
+
+// RateLimiter controls how often an already-authenticated user may proceed
+// past Handle. It exists separately from the auth-failure lockout in this
+// file, which guards the expensive Lookup+ecdsa.Verify path against
+// attackers who have not authenticated at all.
+type RateLimiter interface {
+	// Allow reports whether a request from user should proceed. If not,
+	// retryAfter is how long the caller should wait before retrying.
+	Allow(user upspin.UserName) (allowed bool, retryAfter time.Duration)
+}
+
+// tokenBucket is a simple requests-per-second limiter with burst capacity.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucketLimiter is an in-memory RateLimiter keeping one token bucket
+// per user, bounded to a configurable number of concurrently tracked users.
+type TokenBucketLimiter struct {
+	ratePerSecond float64
+	burst         float64
+	buckets       *cache.LRU // maps upspin.UserName to *tokenBucket.
+}
+
+var _ RateLimiter = (*TokenBucketLimiter)(nil)
+
+// NewTokenBucketLimiter returns a RateLimiter that allows each user up to
+// burst requests immediately and ratePerSecond requests/sec thereafter,
+// tracking at most maxUsers users concurrently.
+func NewTokenBucketLimiter(ratePerSecond float64, burst, maxUsers int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		ratePerSecond: ratePerSecond,
+		burst:         float64(burst),
+		buckets:       cache.NewLRU(maxUsers),
+	}
+}
+
+// Allow implements RateLimiter.
+func (l *TokenBucketLimiter) Allow(user upspin.UserName) (bool, time.Duration) {
+	b := l.bucketFor(user)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * l.ratePerSecond
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.ratePerSecond * float64(time.Second))
+}
+
+func (l *TokenBucketLimiter) bucketFor(user upspin.UserName) *tokenBucket {
+	if v, ok := l.buckets.Get(user); ok {
+		return v.(*tokenBucket)
+	}
+	b := &tokenBucket{tokens: l.burst, last: time.Now()}
+	l.buckets.Add(user, b)
+	return b
+}
+
+// failureRecord tracks consecutive auth failures for a user name or IP, for
+// the exponential backoff implemented by checkLockout/recordAuthFailure.
+type failureRecord struct {
+	mu          sync.Mutex
+	count       int
+	lockedUntil time.Time
+}
+
+// rateLimitError is returned by doAuth when a claimed user name or source IP
+// is locked out. Handle recognizes it and responds 429 Too Many Requests
+// with a Retry-After header instead of the usual 401.
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("auth: too many failed authentication attempts; retry after %v", e.retryAfter)
+}
+
+// remoteIPKey returns the client IP from r.RemoteAddr, with any port
+// stripped, for use as a failure-tracking key alongside the claimed user name.
+func remoteIPKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (ah *authHandler) failuresFor(key string) *failureRecord {
+	if v, ok := ah.failureCache.Get(key); ok {
+		return v.(*failureRecord)
+	}
+	f := &failureRecord{}
+	ah.failureCache.Add(key, f)
+	return f
+}
+
+// checkLockout reports, as a *rateLimitError, whether key is currently
+// locked out due to repeated authentication failures. It returns nil if key
+// may proceed.
+func (ah *authHandler) checkLockout(key string) *rateLimitError {
+	f := ah.failuresFor(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lockedUntil.IsZero() || time.Now().After(f.lockedUntil) {
+		return nil
+	}
+	return &rateLimitError{retryAfter: time.Until(f.lockedUntil)}
+}
+
+// recordAuthFailure increments key's failure count and, once
+// Config.MaxAuthFailures is reached, locks it out for a duration that
+// doubles with each further failure: base, 2*base, 4*base, and so on.
+func (ah *authHandler) recordAuthFailure(key string) {
+	maxFailures := ah.config.MaxAuthFailures
+	if maxFailures == 0 {
+		maxFailures = defaultMaxAuthFailures
+	}
+	base := ah.config.LockoutBase
+	if base == 0 {
+		base = defaultLockoutBase
+	}
+	f := ah.failuresFor(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count++
+	if f.count < maxFailures {
+		return
+	}
+	f.lockedUntil = time.Now().Add(base << uint(f.count-maxFailures))
+}
+
+// recordAuthSuccess clears key's failure count and any active lockout.
+func (ah *authHandler) recordAuthSuccess(key string) {
+	f := ah.failuresFor(key)
+	f.mu.Lock()
+	f.count = 0
+	f.lockedUntil = time.Time{}
+	f.mu.Unlock()
+}
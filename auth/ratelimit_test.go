@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+func TestTokenBucketLimiterAllowsBurstThenThrottles(t *testing.T) {
+	l := NewTokenBucketLimiter(1, 2, 10)
+	user := upspin.UserName("user@example.com")
+	if ok, _ := l.Allow(user); !ok {
+		t.Fatal("first request should be allowed")
+	}
+	if ok, _ := l.Allow(user); !ok {
+		t.Fatal("second request, within burst, should be allowed")
+	}
+	ok, retryAfter := l.Allow(user)
+	if ok {
+		t.Fatal("third immediate request should be throttled")
+	}
+	if retryAfter <= 0 {
+		t.Fatalf("expected a positive retryAfter, got %v", retryAfter)
+	}
+}
+
+func TestTokenBucketLimiterTracksUsersIndependently(t *testing.T) {
+	l := NewTokenBucketLimiter(1, 1, 10)
+	alice := upspin.UserName("alice@example.com")
+	bob := upspin.UserName("bob@example.com")
+	if ok, _ := l.Allow(alice); !ok {
+		t.Fatal("alice's first request should be allowed")
+	}
+	if ok, _ := l.Allow(alice); ok {
+		t.Fatal("alice's second immediate request should be throttled")
+	}
+	if ok, _ := l.Allow(bob); !ok {
+		t.Fatal("bob should have his own bucket, unaffected by alice's requests")
+	}
+}
+
+func TestCheckLockoutAllowsKeyWithNoFailures(t *testing.T) {
+	ah := newTestHandler(t, nil)
+	if err := ah.checkLockout("1.2.3.4"); err != nil {
+		t.Fatalf("unexpected lockout with no recorded failures: %v", err)
+	}
+}
+
+func TestLockoutTriggersAtMaxAuthFailures(t *testing.T) {
+	ah := newTestHandler(t, &Config{MaxAuthFailures: 2, LockoutBase: 10 * time.Millisecond})
+	key := "1.2.3.4"
+
+	ah.recordAuthFailure(key)
+	if err := ah.checkLockout(key); err != nil {
+		t.Fatalf("unexpected lockout below MaxAuthFailures: %v", err)
+	}
+	ah.recordAuthFailure(key)
+	if err := ah.checkLockout(key); err == nil {
+		t.Fatal("expected lockout once MaxAuthFailures is reached")
+	}
+}
+
+func TestRecordAuthSuccessClearsLockout(t *testing.T) {
+	ah := newTestHandler(t, &Config{MaxAuthFailures: 1, LockoutBase: 10 * time.Millisecond})
+	key := "1.2.3.4"
+
+	ah.recordAuthFailure(key)
+	if err := ah.checkLockout(key); err == nil {
+		t.Fatal("expected lockout")
+	}
+	ah.recordAuthSuccess(key)
+	if err := ah.checkLockout(key); err != nil {
+		t.Fatalf("success should clear the lockout: %v", err)
+	}
+}
+
+func TestLockoutBackoffDoublesWithRepeatedFailures(t *testing.T) {
+	ah := newTestHandler(t, &Config{MaxAuthFailures: 1, LockoutBase: 10 * time.Millisecond})
+	key := "5.6.7.8"
+
+	ah.recordAuthFailure(key)
+	first := ah.checkLockout(key)
+	if first == nil {
+		t.Fatal("expected lockout after reaching MaxAuthFailures")
+	}
+
+	ah.recordAuthFailure(key)
+	second := ah.checkLockout(key)
+	if second == nil {
+		t.Fatal("expected lockout to still be in effect")
+	}
+	if second.retryAfter <= first.retryAfter {
+		t.Fatalf("expected backoff to grow with repeated failures, got %v then %v", first.retryAfter, second.retryAfter)
+	}
+}
+
+// TestLockoutKeysAreIndependent guards the chunk0-5 fix: a bare user-name key
+// and an IP key must be tracked independently, since doAuth no longer treats
+// the user-name key as blocking on its own (an attacker who knows a user
+// name, but not their key, must otherwise be able to lock that user out from
+// any IP).
+func TestLockoutKeysAreIndependent(t *testing.T) {
+	ah := newTestHandler(t, &Config{MaxAuthFailures: 1, LockoutBase: 10 * time.Millisecond})
+	ah.recordAuthFailure("victim@example.com")
+	if err := ah.checkLockout("9.9.9.9|victim@example.com"); err != nil {
+		t.Fatalf("a failure recorded under the bare user-name key must not lock out a distinct (IP, user) key: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+func newTestHandler(t *testing.T, cfg *Config) *authHandler {
+	t.Helper()
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	ah, ok := NewHandler(cfg).(*authHandler)
+	if !ok {
+		t.Fatal("NewHandler did not return *authHandler")
+	}
+	return ah
+}
+
+func newFreshnessRequest(user upspin.UserName, ts time.Time, nonce string) *http.Request {
+	req := httptest.NewRequest("GET", "/get", nil)
+	req.Header.Set(userNameHeader, string(user))
+	req.Header.Set(timestampHeader, strconv.FormatInt(ts.Unix(), 10))
+	req.Header.Set(nonceHeader, nonce)
+	return req
+}
+
+func TestVerifyFreshnessAcceptsRequestWithinSkew(t *testing.T) {
+	ah := newTestHandler(t, nil)
+	req := newFreshnessRequest("user@example.com", time.Now(), "nonce-1")
+	if err := ah.verifyFreshness("user@example.com", req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyFreshnessRejectsStaleTimestamp(t *testing.T) {
+	ah := newTestHandler(t, &Config{MaxClockSkew: time.Minute})
+	req := newFreshnessRequest("user@example.com", time.Now().Add(-10*time.Minute), "nonce-2")
+	if err := ah.verifyFreshness("user@example.com", req); err == nil {
+		t.Fatal("expected error for stale timestamp")
+	}
+}
+
+func TestVerifyFreshnessRejectsFutureTimestamp(t *testing.T) {
+	ah := newTestHandler(t, &Config{MaxClockSkew: time.Minute})
+	req := newFreshnessRequest("user@example.com", time.Now().Add(10*time.Minute), "nonce-3")
+	if err := ah.verifyFreshness("user@example.com", req); err == nil {
+		t.Fatal("expected error for future timestamp")
+	}
+}
+
+func TestVerifyFreshnessRejectsMissingHeaders(t *testing.T) {
+	ah := newTestHandler(t, nil)
+	req := httptest.NewRequest("GET", "/get", nil)
+	if err := ah.verifyFreshness("user@example.com", req); err == nil {
+		t.Fatal("expected error for missing timestamp/nonce headers")
+	}
+}
+
+// TestNonceNotBurnedUntilRecorded guards against a prior bug where
+// verifyFreshness itself recorded the nonce: a request that ultimately
+// failed signature verification for an unrelated reason would have
+// permanently burned the nonce, rejecting a legitimate client's retry as a
+// false replay.
+func TestNonceNotBurnedUntilRecorded(t *testing.T) {
+	ah := newTestHandler(t, nil)
+	user := upspin.UserName("user@example.com")
+	req := newFreshnessRequest(user, time.Now(), "nonce-4")
+
+	if err := ah.verifyFreshness(user, req); err != nil {
+		t.Fatalf("first check should be accepted: %v", err)
+	}
+	if err := ah.verifyFreshness(user, req); err != nil {
+		t.Fatalf("nonce should not be burned before recordNonce is called: %v", err)
+	}
+	ah.recordNonce(user, req)
+	if err := ah.verifyFreshness(user, req); err == nil {
+		t.Fatal("expected replay rejection once the nonce has been recorded")
+	}
+}
+
+func TestBindFreshnessCommitsToHeaders(t *testing.T) {
+	base := []byte("base-hash")
+	reqA := newFreshnessRequest("user@example.com", time.Unix(1000, 0), "nonce-a")
+	reqB := newFreshnessRequest("user@example.com", time.Unix(1000, 0), "nonce-b")
+
+	hashA := bindFreshness(base, reqA)
+	hashB := bindFreshness(base, reqB)
+	if string(hashA) == string(hashB) {
+		t.Fatal("bindFreshness must produce different output for different nonces, or a captured signature would verify against a substituted nonce")
+	}
+
+	hashAAgain := bindFreshness(base, reqA)
+	if string(hashA) != string(hashAAgain) {
+		t.Fatal("bindFreshness must be deterministic for identical inputs")
+	}
+}
@@ -3,26 +3,24 @@ Package auth handles authentication of Upspin users.
 
 Sample usage:
 
-   authHandler := auth.NewHandler(&auth.Config{Lookup: context.User.Lookup})
-
-   rawHandler := func(session auth.Session, w http.ResponseWriter, r *http.Request) {
-   	user := session.User()
-   	w.Write([]byte(fmt.Sprintf("Hello Authenticated user %v", user)))
-   }
-   http.HandleFunc("/hellowithauth", authHandler.Handle(rawHandler))
-   // Configure TLS here if necessary ...
-   ListenAndServeTLS(":443", nil)
+	authHandler := auth.NewHandler(&auth.Config{Lookup: context.User.Lookup})
+
+	rawHandler := func(session auth.Session, w http.ResponseWriter, r *http.Request) {
+		user := session.User()
+		w.Write([]byte(fmt.Sprintf("Hello Authenticated user %v", user)))
+	}
+	http.HandleFunc("/hellowithauth", authHandler.Handle(rawHandler))
+	// Configure TLS here if necessary ...
+	ListenAndServeTLS(":443", nil)
 */
 package auth
 
 import (
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"log"
-	"math/big"
 	"net/http"
-	"strings"
+	"time"
 
 	"upspin.googlesource.com/upspin.git/cache"
 	"upspin.googlesource.com/upspin.git/cloud/netutil"
@@ -46,6 +44,52 @@ type Config struct {
 
 	// AllowUnauthenticatedConnections allows unauthenticated connections, making it the caller's responsibility to check Handler.IsAuthenticated.
 	AllowUnauthenticatedConnections bool
+
+	// Providers is consulted, in order, when a request has no signatureHeader
+	// but carries a bearer token in its Authorization header. The first
+	// provider that verifies the token wins.
+	Providers []IdentityProvider
+
+	// MapIdentity resolves a provider's verified claims to an Upspin user
+	// name. If nil, defaultMapIdentity is used, which requires a verified
+	// email claim.
+	MapIdentity MapIdentityFunc
+
+	// SessionKey, if set, enables the "/auth/session" endpoint (see
+	// NewSessionHandler) and validation of the Upspin-Session-Token
+	// header as an alternative to a per-request ECDSA signature.
+	SessionKey []byte
+
+	// MaxClockSkew bounds how far a request's Upspin-Timestamp header may
+	// drift from the server's clock before it is rejected. If zero,
+	// defaultMaxClockSkew is used.
+	MaxClockSkew time.Duration
+
+	// NonceCacheSize is the number of (user, nonce) pairs remembered to
+	// reject replayed requests. If zero, defaultNonceCacheSize is used.
+	NonceCacheSize int
+
+	// SessionStore caches authenticated sessions keyed by TLSUnique value
+	// or bearer-token hash. If nil, an in-process LRU of maxSessions
+	// entries is used; pass a shared implementation (see
+	// auth/sessionstore) when running multiple server instances behind
+	// a load balancer.
+	SessionStore SessionStore
+
+	// RateLimiter, if set, is consulted once a request is authenticated
+	// to throttle how often its user may proceed.
+	RateLimiter RateLimiter
+
+	// MaxAuthFailures is the number of consecutive Lookup/verifyRequest
+	// failures, for the same source IP or (source IP, claimed user name)
+	// pair, allowed before that key is locked out with exponential
+	// backoff. If zero, defaultMaxAuthFailures is used.
+	MaxAuthFailures int
+
+	// LockoutBase is the initial backoff duration applied once
+	// MaxAuthFailures is reached; it doubles with each further failure.
+	// If zero, defaultLockoutBase is used.
+	LockoutBase time.Duration
 }
 
 // Session contains information about the connection and the authenticated user, if any.
@@ -72,7 +116,9 @@ var _ Session = (*sessionImpl)(nil)
 // authHandler implements a Handler that ensures cryptography-grade authentication.
 type authHandler struct {
 	config       *Config
-	sessionCache *cache.LRU // maps tlsUnique to AuthSession. Thread-safe.
+	sessionCache SessionStore // maps tlsUnique or bearer-token hash to Session. Thread-safe.
+	nonceCache   *cache.LRU   // maps "user/nonce" to struct{}, to reject replays. Thread-safe.
+	failureCache *cache.LRU   // maps a user name or remote IP to *failureRecord. Thread-safe.
 }
 
 var _ Handler = (*authHandler)(nil)
@@ -81,13 +127,42 @@ const (
 	// maxSessions defines the maximum number of connections to remember before we re-auth them.
 	// This also limits the number of parallel requests we can service, so do not set it to small numbers.
 	maxSessions = 1000
+
+	// defaultMaxClockSkew is used when Config.MaxClockSkew is zero.
+	defaultMaxClockSkew = 5 * time.Minute
+
+	// defaultNonceCacheSize is used when Config.NonceCacheSize is zero.
+	defaultNonceCacheSize = 10000
+
+	// maxTrackedFailureKeys bounds the number of distinct user names and
+	// IPs whose auth-failure counts are remembered for lockout purposes.
+	maxTrackedFailureKeys = 10000
+
+	// tlsSessionTTL bounds how long a TLSUnique-keyed session is cached.
+	// Without a ttl, a SessionStore backed by a shared cache (see
+	// auth/sessionstore) would keep a row per TLS connection forever,
+	// since nothing in this package ever calls Delete for these keys. The
+	// in-process default also drops these entries once the ttl passes,
+	// though its LRU eviction already bounds its size; a shared store has
+	// no such bound of its own.
+	tlsSessionTTL = 24 * time.Hour
 )
 
 // NewHandler creates a new instance of a Handler according to the given config, which must not be changed subsequently by the caller.
 func NewHandler(config *Config) Handler {
+	nonceCacheSize := config.NonceCacheSize
+	if nonceCacheSize == 0 {
+		nonceCacheSize = defaultNonceCacheSize
+	}
+	sessionStore := config.SessionStore
+	if sessionStore == nil {
+		sessionStore = newLRUSessionStore(maxSessions)
+	}
 	return &authHandler{
 		config:       config,
-		sessionCache: cache.NewLRU(maxSessions),
+		sessionCache: sessionStore,
+		nonceCache:   cache.NewLRU(nonceCacheSize),
+		failureCache: cache.NewLRU(maxTrackedFailureKeys),
 	}
 }
 
@@ -111,7 +186,7 @@ func (ah *authHandler) setTLSUnique(session *sessionImpl, tlsUnique string) {
 		log.Printf("Invalid tlsUnique for user %q", session.user)
 		return
 	}
-	ah.sessionCache.Add(tlsUnique, session)
+	ah.sessionCache.Add(tlsUnique, session, tlsSessionTTL)
 }
 
 func (ah *authHandler) getSessionByTLSUnique(tlsUnique string) *sessionImpl {
@@ -142,18 +217,70 @@ func (ah *authHandler) doAuth(w http.ResponseWriter, r *http.Request) (*sessionI
 			return session, nil
 		}
 	}
+	// A session token, if present, replaces the Lookup+ecdsa.Verify pair
+	// entirely; it's cheaper and is how clients normally authenticate
+	// after their first request (see NewSessionHandler).
+	if token := r.Header.Get(sessionTokenHeader); token != "" {
+		session, err := ah.doAuthWithSessionToken(r, token)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.TLS.TLSUnique) > 0 {
+			ah.setTLSUnique(session, string(r.TLS.TLSUnique))
+		}
+		return session, nil
+	}
+	// If there's no ECDSA signature, fall back to bearer-token authentication
+	// against the configured identity providers, if any.
+	if r.Header.Get(signatureHeader) == "" && len(ah.config.Providers) > 0 {
+		session, err := ah.doAuthWithIdentityProviders(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.TLS.TLSUnique) > 0 {
+			ah.setTLSUnique(session, string(r.TLS.TLSUnique))
+		}
+		return session, nil
+	}
 	// Let's authenticate from scratch, if we have enough info.
 	if ah.config.Lookup == nil {
 		return nil, errors.New("cannot authenticate: internal error: missing Lookup function")
 	}
+	// A source IP with too many recent failures is locked out, so we
+	// never pay for Lookup+ecdsa.Verify on its behalf. Lockout is never
+	// keyed on the claimed user name alone: that name comes straight
+	// from the unauthenticated userNameHeader, so anyone could lock out
+	// an arbitrary known Upspin user just by failing auth as them
+	// repeatedly. Keying on (IP, user name) instead confines the damage
+	// to requests from the attacker's own IP; recordAuthFailure/
+	// recordAuthSuccess also still track the user name alone, but only
+	// as an advisory signal (e.g. for monitoring) that nothing here
+	// enforces a lockout from.
+	ipKey := remoteIPKey(r)
+	ipUserKey := ipKey + "|" + string(user)
+	if lockErr := ah.checkLockout(ipKey); lockErr != nil {
+		return nil, lockErr
+	}
+	if lockErr := ah.checkLockout(ipUserKey); lockErr != nil {
+		return nil, lockErr
+	}
 	keys, err := ah.config.Lookup(user)
 	if err != nil {
+		ah.recordAuthFailure(ipKey)
+		ah.recordAuthFailure(ipUserKey)
+		ah.recordAuthFailure(string(user))
 		return nil, err
 	}
-	err = verifyRequest(user, keys, r)
+	err = ah.verifyRequest(user, keys, r)
 	if err != nil {
+		ah.recordAuthFailure(ipKey)
+		ah.recordAuthFailure(ipUserKey)
+		ah.recordAuthFailure(string(user))
 		return nil, err
 	}
+	ah.recordAuthSuccess(ipKey)
+	ah.recordAuthSuccess(ipUserKey)
+	ah.recordAuthSuccess(string(user))
 	// Success! Create a new session and cache it if we have a TLSUnique.
 	session := &sessionImpl{
 		isAuth: true,
@@ -173,6 +300,15 @@ func (ah *authHandler) Handle(authHandlerFunc HandlerFunc) func(w http.ResponseW
 		var session *sessionImpl
 		session, err := ah.doAuth(w, r)
 		if err != nil {
+			if rlErr, ok := err.(*rateLimitError); ok {
+				// Locked out for too many recent auth failures; tell the
+				// client when it may try again rather than pretending
+				// this is an ordinary authentication failure.
+				w.Header().Set("Retry-After", fmt.Sprintf("%.0f", rlErr.retryAfter.Seconds()))
+				w.WriteHeader(http.StatusTooManyRequests)
+				netutil.SendJSONError(w, "AuthHandler:", err)
+				return
+			}
 			if !ah.config.AllowUnauthenticatedConnections {
 				// Return an error to the client and do not call the underlying handler function.
 				log.Printf("HTTPClient: auth error: %v", err)
@@ -185,6 +321,14 @@ func (ah *authHandler) Handle(authHandlerFunc HandlerFunc) func(w http.ResponseW
 				err: err,
 			}
 		}
+		if session.isAuth && ah.config.RateLimiter != nil {
+			if allowed, retryAfter := ah.config.RateLimiter.Allow(session.user); !allowed {
+				w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
+				w.WriteHeader(http.StatusTooManyRequests)
+				netutil.SendJSONError(w, "AuthHandler:", fmt.Errorf("auth: rate limit exceeded for %s", session.user))
+				return
+			}
+		}
 		// session is guaranteed non-nil here.
 		authHandlerFunc(session, w, r)
 	}
@@ -192,7 +336,13 @@ func (ah *authHandler) Handle(authHandlerFunc HandlerFunc) func(w http.ResponseW
 }
 
 // verifyRequest verifies whether named user has signed the HTTP request using one of the possible keys.
-func verifyRequest(userName upspin.UserName, keys []upspin.PublicKey, req *http.Request) error {
+// It also rejects requests whose Upspin-Timestamp is outside the configured clock skew and requests
+// that reuse an (user, Upspin-Nonce) pair already seen, closing the replay window that a bare signature
+// check leaves open: a captured Authorization header is otherwise valid for as long as the signing key is.
+func (ah *authHandler) verifyRequest(userName upspin.UserName, keys []upspin.PublicKey, req *http.Request) error {
+	if err := ah.verifyFreshness(userName, req); err != nil {
+		return err
+	}
 	sig := req.Header.Get(signatureHeader)
 	if sig == "" {
 		return errors.New("no signature in header")
@@ -201,31 +351,30 @@ func verifyRequest(userName upspin.UserName, keys []upspin.PublicKey, req *http.
 	if neededKeyType == "" {
 		return errors.New("no signature type in header")
 	}
-	sigPieces := strings.Fields(sig)
-	if len(sigPieces) != 2 {
-		return fmt.Errorf("expected two integers in signature, got %d", len(sigPieces))
-	}
-	var rs, ss big.Int
-	_, ok := rs.SetString(sigPieces[0], 10)
-	if !ok {
-		return errMissingSignature
-	}
-	_, ok = ss.SetString(sigPieces[1], 10)
+	verifier, ok := verifiers[neededKeyType]
 	if !ok {
-		return errMissingSignature
+		// p256, p384 and p521 ECDSA keys have no entry in verifiers
+		// because they predate it; fall back to the original path.
+		verifier = ecdsaVerifier{}
 	}
+	// Folding the timestamp and nonce into the hash binds the signature to
+	// their exact values; verifyFreshness alone only checks them against
+	// the server's clock and nonce cache, which a captured signature
+	// would otherwise remain valid against no matter what values an
+	// attacker substituted.
+	hash := bindFreshness(hashUserRequest(userName, req), req)
 	for _, k := range keys {
-		ecdsaPubKey, keyType, err := keyloader.ParsePublicKey(k)
+		_, keyType, err := keyloader.ParsePublicKey(k)
 		if err != nil {
 			return err
 		}
 		if keyType != neededKeyType {
 			continue
 		}
-		hash := hashUserRequest(userName, req)
-		if !ecdsa.Verify(ecdsaPubKey, hash, &rs, &ss) {
-			return fmt.Errorf("signature verification failed for user %s", userName)
+		if err := verifier.Verify(k, hash, sig); err != nil {
+			return fmt.Errorf("signature verification failed for user %s: %v", userName, err)
 		}
+		ah.recordNonce(userName, req)
 		return nil
 	}
 	return fmt.Errorf("no keys found for user %s", userName)
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"time"
+
+	"upspin.googlesource.com/upspin.git/cache"
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+// SessionStore holds authenticated Sessions keyed by an opaque string, such
+// as a TLSUnique value or a bearer-token hash. The default implementation
+// returned by NewHandler is in-process and therefore only as useful as a
+// single server instance; running directory or store servers behind a load
+// balancer calls for a shared implementation (see auth/sessionstore) so a
+// session established against one instance is recognized by the others.
+type SessionStore interface {
+	// Get returns the Session cached under key, if any. An entry whose
+	// ttl (passed to Add) has elapsed is treated as absent.
+	Get(key string) (Session, bool)
+
+	// Add caches session under key. If ttl is non-zero, the entry expires
+	// after ttl elapses, enforced by every implementation in this package
+	// (not just out-of-process backends): a session cached with an
+	// expiry is never returned by Get once it has passed, regardless of
+	// whether the entry has also been evicted from underlying storage.
+	Add(key string, session Session, ttl time.Duration)
+
+	// Delete removes any Session cached under key.
+	Delete(key string)
+}
+
+// NewSession returns a Session reporting the given user and authentication
+// state. It exists so that out-of-process SessionStore implementations,
+// which cannot construct the package's unexported Session type directly,
+// can reconstruct a Session from data read back from the store.
+func NewSession(user upspin.UserName, isAuthenticated bool) Session {
+	return &sessionImpl{
+		user:   user,
+		isAuth: isAuthenticated,
+	}
+}
+
+// lruSessionStore is the default, in-process SessionStore, backed by a
+// bounded LRU cache. It is what NewHandler uses when Config.SessionStore is
+// nil.
+type lruSessionStore struct {
+	lru *cache.LRU
+}
+
+var _ SessionStore = (*lruSessionStore)(nil)
+
+// lruSessionEntry is what lruSessionStore actually stores under a key, so
+// that Get can enforce the ttl passed to Add instead of silently ignoring
+// it and relying on LRU eviction alone, which has no relation to how long
+// the caller wanted the entry to live.
+type lruSessionEntry struct {
+	session Session
+	expiry  time.Time // zero if the entry has no ttl.
+}
+
+func newLRUSessionStore(maxEntries int) *lruSessionStore {
+	return &lruSessionStore{lru: cache.NewLRU(maxEntries)}
+}
+
+// Get implements SessionStore.
+func (s *lruSessionStore) Get(key string) (Session, bool) {
+	v, ok := s.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entry := v.(lruSessionEntry)
+	if !entry.expiry.IsZero() && time.Now().After(entry.expiry) {
+		s.lru.Remove(key)
+		return nil, false
+	}
+	return entry.session, true
+}
+
+// Add implements SessionStore.
+func (s *lruSessionStore) Add(key string, session Session, ttl time.Duration) {
+	var expiry time.Time
+	if ttl > 0 {
+		expiry = time.Now().Add(ttl)
+	}
+	s.lru.Add(key, lruSessionEntry{session: session, expiry: expiry})
+}
+
+// Delete implements SessionStore.
+func (s *lruSessionStore) Delete(key string) {
+	s.lru.Remove(key)
+}
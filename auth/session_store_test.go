@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+func TestLRUSessionStoreRoundTrip(t *testing.T) {
+	s := newLRUSessionStore(10)
+	session := NewSession("user@example.com", true)
+
+	s.Add("key", session, 0)
+	got, ok := s.Get("key")
+	if !ok {
+		t.Fatal("expected a cached session")
+	}
+	if got.User() != upspin.UserName("user@example.com") || !got.IsAuthenticated() {
+		t.Fatalf("got %+v, want the session that was added", got)
+	}
+}
+
+func TestLRUSessionStoreDelete(t *testing.T) {
+	s := newLRUSessionStore(10)
+	s.Add("key", NewSession("user@example.com", true), 0)
+	s.Delete("key")
+	if _, ok := s.Get("key"); ok {
+		t.Fatal("expected no session after Delete")
+	}
+}
+
+// TestLRUSessionStoreHonorsTTL guards the fix for a prior bug where Add's
+// ttl parameter was silently dropped by the in-process store, letting a
+// cached bearer-token session (or any other ttl-bound entry) survive until
+// LRU eviction instead of its intended expiry.
+func TestLRUSessionStoreHonorsTTL(t *testing.T) {
+	s := newLRUSessionStore(10)
+	s.Add("key", NewSession("user@example.com", true), 10*time.Millisecond)
+
+	if _, ok := s.Get("key"); !ok {
+		t.Fatal("expected the session to be present before its ttl elapses")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := s.Get("key"); ok {
+		t.Fatal("expected the session to be gone once its ttl has elapsed")
+	}
+}
+
+func TestLRUSessionStoreZeroTTLNeverExpires(t *testing.T) {
+	s := newLRUSessionStore(10)
+	s.Add("key", NewSession("user@example.com", true), 0)
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := s.Get("key"); !ok {
+		t.Fatal("a zero ttl should mean no expiry, only LRU eviction")
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+// sessionTokenHeader carries a short-lived bearer token minted by
+// NewSessionHandler, letting a client that has just completed one ECDSA
+// challenge avoid paying for a Lookup and ecdsa.Verify on every subsequent
+// request.
+const sessionTokenHeader = "Upspin-Session-Token"
+
+// SessionTokenTTL is the lifetime of tokens minted by NewSessionHandler.
+const SessionTokenTTL = 1 * time.Hour
+
+// sessionTokenPayload is the signed portion of a session token.
+type sessionTokenPayload struct {
+	User      upspin.UserName `json:"user"`
+	Expiry    int64           `json:"expiry"` // Unix seconds.
+	TLSUnique string          `json:"tlsUnique"`
+}
+
+// signSessionToken returns "<base64 payload>.<base64 HMAC-SHA256>" for the
+// given payload, signed with key.
+func signSessionToken(key []byte, payload sessionTokenPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return encoded + "." + sig, nil
+}
+
+// verifySessionToken checks the token's MAC and expiry and returns its payload.
+func verifySessionToken(key []byte, token string) (*sessionTokenPayload, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return nil, errors.New("auth: malformed session token")
+	}
+	encoded, sig := token[:i], token[i+1:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	wantSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, errors.New("auth: malformed session token signature")
+	}
+	if !hmac.Equal(mac.Sum(nil), wantSig) {
+		return nil, errors.New("auth: session token signature mismatch")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("auth: malformed session token payload")
+	}
+	var payload sessionTokenPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, errors.New("auth: malformed session token payload")
+	}
+	if time.Now().After(time.Unix(payload.Expiry, 0)) {
+		return nil, fmt.Errorf("auth: session token for %s expired", payload.User)
+	}
+	return &payload, nil
+}
+
+// NewSessionHandler returns an HTTP handler, suitable for registration at
+// "/auth/session", that performs the usual ECDSA-signed authentication and,
+// on success, issues a session token the client can present via the
+// Upspin-Session-Token header on subsequent requests instead of re-signing
+// every request. ah.config.SessionKey must be set.
+func (ah *authHandler) NewSessionHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := ah.doAuth(w, r)
+		if err != nil || !session.IsAuthenticated() {
+			if err == nil {
+				err = errors.New("auth: not authenticated")
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintf(w, "%v", err)
+			return
+		}
+		if len(ah.config.SessionKey) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "auth: session tokens not configured")
+			return
+		}
+		var tlsUnique string
+		if r.TLS != nil {
+			tlsUnique = string(r.TLS.TLSUnique)
+		}
+		token, err := signSessionToken(ah.config.SessionKey, sessionTokenPayload{
+			User:      session.User(),
+			Expiry:    time.Now().Add(SessionTokenTTL).Unix(),
+			TLSUnique: tlsUnique,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "auth: minting session token: %v", err)
+			return
+		}
+		w.Write([]byte(token))
+	}
+}
+
+// doAuthWithSessionToken validates the Upspin-Session-Token header against
+// ah.config.SessionKey, without performing a Lookup or ECDSA verification.
+func (ah *authHandler) doAuthWithSessionToken(r *http.Request, token string) (*sessionImpl, error) {
+	if len(ah.config.SessionKey) == 0 {
+		return nil, errors.New("auth: session tokens not configured")
+	}
+	payload, err := verifySessionToken(ah.config.SessionKey, token)
+	if err != nil {
+		return nil, err
+	}
+	if r.TLS != nil && len(r.TLS.TLSUnique) > 0 && payload.TLSUnique != "" && payload.TLSUnique != string(r.TLS.TLSUnique) {
+		return nil, errors.New("auth: session token bound to a different TLS channel")
+	}
+	return &sessionImpl{
+		isAuth: true,
+		user:   payload.User,
+	}, nil
+}
+
+// FetchSessionToken is a client-side helper that performs a single signed
+// request against the server's "/auth/session" endpoint (using req, which
+// the caller must have already populated with signatureHeader and friends
+// via the usual request-signing path) and returns the resulting session
+// token on success.
+func FetchSessionToken(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("auth: fetching session token: server returned %s", resp.Status)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if len(buf) == 0 {
+		return "", errors.New("auth: empty session token response")
+	}
+	return string(buf), nil
+}
+
+// SetSessionToken attaches a session token, previously obtained from
+// FetchSessionToken, to req so the server can authenticate it without a
+// fresh ECDSA signature.
+func SetSessionToken(req *http.Request, token string) {
+	req.Header.Set(sessionTokenHeader, token)
+}
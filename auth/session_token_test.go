@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+func TestSessionTokenRoundTrip(t *testing.T) {
+	ah := newTestHandler(t, &Config{SessionKey: []byte("test-key")})
+	user := upspin.UserName("user@example.com")
+	token, err := signSessionToken(ah.config.SessionKey, sessionTokenPayload{
+		User:   user,
+		Expiry: time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("signSessionToken: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := ah.doAuthWithSessionToken(req, token)
+	if err != nil {
+		t.Fatalf("expected valid token to verify: %v", err)
+	}
+	if session.User() != user {
+		t.Fatalf("got user %q, want %q", session.User(), user)
+	}
+}
+
+func TestSessionTokenRejectsExpired(t *testing.T) {
+	ah := newTestHandler(t, &Config{SessionKey: []byte("test-key")})
+	token, err := signSessionToken(ah.config.SessionKey, sessionTokenPayload{
+		User:   "user@example.com",
+		Expiry: time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("signSessionToken: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := ah.doAuthWithSessionToken(req, token); err == nil {
+		t.Fatal("expected error for expired token")
+	}
+}
+
+func TestSessionTokenRejectsTamperedSignature(t *testing.T) {
+	ah := newTestHandler(t, &Config{SessionKey: []byte("test-key")})
+	token, err := signSessionToken(ah.config.SessionKey, sessionTokenPayload{
+		User:   "user@example.com",
+		Expiry: time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("signSessionToken: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := ah.doAuthWithSessionToken(req, token+"x"); err == nil {
+		t.Fatal("expected error for tampered token")
+	}
+}
+
+func TestSessionTokenRejectsWrongKey(t *testing.T) {
+	signer := newTestHandler(t, &Config{SessionKey: []byte("key-one")})
+	verifier := newTestHandler(t, &Config{SessionKey: []byte("key-two")})
+	token, err := signSessionToken(signer.config.SessionKey, sessionTokenPayload{
+		User:   "user@example.com",
+		Expiry: time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("signSessionToken: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := verifier.doAuthWithSessionToken(req, token); err == nil {
+		t.Fatal("expected error verifying a token signed with a different key")
+	}
+}
+
+func TestSessionTokenRejectsMismatchedTLSChannel(t *testing.T) {
+	ah := newTestHandler(t, &Config{SessionKey: []byte("test-key")})
+	token, err := signSessionToken(ah.config.SessionKey, sessionTokenPayload{
+		User:      "user@example.com",
+		Expiry:    time.Now().Add(time.Hour).Unix(),
+		TLSUnique: "channel-a",
+	})
+	if err != nil {
+		t.Fatalf("signSessionToken: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{TLSUnique: []byte("channel-b")}
+	if _, err := ah.doAuthWithSessionToken(req, token); err == nil {
+		t.Fatal("expected error for a session token bound to a different TLS channel")
+	}
+}
+
+func TestSessionTokenRequiresSessionKeyConfigured(t *testing.T) {
+	ah := newTestHandler(t, nil)
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := ah.doAuthWithSessionToken(req, "anything"); err == nil {
+		t.Fatal("expected error when Config.SessionKey is unset")
+	}
+}
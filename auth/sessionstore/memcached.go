@@ -0,0 +1,70 @@
+package sessionstore
+
+import (
+	"log"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	"upspin.googlesource.com/upspin.git/auth"
+)
+
+// Memcached is a SessionStore backed by a Memcached cluster, suitable for
+// sharing authenticated sessions across multiple server instances.
+type Memcached struct {
+	client *memcache.Client
+}
+
+var _ auth.SessionStore = (*Memcached)(nil)
+
+// NewMemcached returns a Memcached-backed SessionStore using the given client.
+func NewMemcached(client *memcache.Client) *Memcached {
+	return &Memcached{client: client}
+}
+
+// Get implements auth.SessionStore.
+func (m *Memcached) Get(key string) (auth.Session, bool) {
+	item, err := m.client.Get(key)
+	if err != nil {
+		if err != memcache.ErrCacheMiss {
+			log.Printf("sessionstore: memcached Get %q: %v", key, err)
+		}
+		return nil, false
+	}
+	session, err := unmarshalSession(item.Value)
+	if err != nil {
+		log.Printf("sessionstore: memcached: decoding session for %q: %v", key, err)
+		return nil, false
+	}
+	return session, true
+}
+
+// Add implements auth.SessionStore.
+func (m *Memcached) Add(key string, session auth.Session, ttl time.Duration) {
+	data, err := marshalSession(session)
+	if err != nil {
+		log.Printf("sessionstore: memcached: encoding session for %q: %v", key, err)
+		return
+	}
+	expiration := int32(ttl / time.Second)
+	if ttl > 0 && expiration == 0 {
+		// A sub-second ttl would truncate to 0, which memcached reads as
+		// "never expires"; don't cache the session at all instead.
+		return
+	}
+	item := &memcache.Item{
+		Key:        key,
+		Value:      data,
+		Expiration: expiration,
+	}
+	if err := m.client.Set(item); err != nil {
+		log.Printf("sessionstore: memcached Set %q: %v", key, err)
+	}
+}
+
+// Delete implements auth.SessionStore.
+func (m *Memcached) Delete(key string) {
+	if err := m.client.Delete(key); err != nil && err != memcache.ErrCacheMiss {
+		log.Printf("sessionstore: memcached Delete %q: %v", key, err)
+	}
+}
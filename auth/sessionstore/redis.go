@@ -0,0 +1,70 @@
+package sessionstore
+
+import (
+	"log"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+
+	"upspin.googlesource.com/upspin.git/auth"
+)
+
+// Redis is a SessionStore backed by a Redis server, suitable for sharing
+// authenticated sessions across multiple server instances.
+type Redis struct {
+	pool *redis.Pool
+}
+
+var _ auth.SessionStore = (*Redis)(nil)
+
+// NewRedis returns a Redis-backed SessionStore using the given connection pool.
+func NewRedis(pool *redis.Pool) *Redis {
+	return &Redis{pool: pool}
+}
+
+// Get implements auth.SessionStore.
+func (r *Redis) Get(key string) (auth.Session, bool) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("GET", key))
+	if err != nil {
+		if err != redis.ErrNil {
+			log.Printf("sessionstore: redis GET %q: %v", key, err)
+		}
+		return nil, false
+	}
+	session, err := unmarshalSession(data)
+	if err != nil {
+		log.Printf("sessionstore: redis: decoding session for %q: %v", key, err)
+		return nil, false
+	}
+	return session, true
+}
+
+// Add implements auth.SessionStore.
+func (r *Redis) Add(key string, session auth.Session, ttl time.Duration) {
+	data, err := marshalSession(session)
+	if err != nil {
+		log.Printf("sessionstore: redis: encoding session for %q: %v", key, err)
+		return
+	}
+	conn := r.pool.Get()
+	defer conn.Close()
+	if ttl > 0 {
+		_, err = conn.Do("SET", key, data, "EX", int64(ttl.Seconds()))
+	} else {
+		_, err = conn.Do("SET", key, data)
+	}
+	if err != nil {
+		log.Printf("sessionstore: redis SET %q: %v", key, err)
+	}
+}
+
+// Delete implements auth.SessionStore.
+func (r *Redis) Delete(key string) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("DEL", key); err != nil {
+		log.Printf("sessionstore: redis DEL %q: %v", key, err)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Package sessionstore provides auth.SessionStore implementations backed by
+shared, out-of-process caches, for use when directory or store servers run
+as multiple instances behind a load balancer. Without a shared store, a
+session established against one instance is invisible to the others,
+forcing a fresh ECDSA verification (or session-token check) on every
+fan-out request that happens to land elsewhere.
+*/
+package sessionstore
+
+import (
+	"encoding/json"
+
+	"upspin.googlesource.com/upspin.git/auth"
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+// wireSession is the serialized form of an auth.Session stored by the
+// backends in this package. It captures only what auth.NewSession needs to
+// reconstruct a Session; the unexported fields of Session's concrete type
+// never leave the auth package.
+type wireSession struct {
+	User   upspin.UserName `json:"user"`
+	IsAuth bool            `json:"isAuth"`
+}
+
+func marshalSession(session auth.Session) ([]byte, error) {
+	return json.Marshal(wireSession{
+		User:   session.User(),
+		IsAuth: session.IsAuthenticated(),
+	})
+}
+
+func unmarshalSession(data []byte) (auth.Session, error) {
+	var w wireSession
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, err
+	}
+	return auth.NewSession(w.User, w.IsAuth), nil
+}
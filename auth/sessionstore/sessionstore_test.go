@@ -0,0 +1,29 @@
+package sessionstore
+
+import (
+	"testing"
+
+	"upspin.googlesource.com/upspin.git/auth"
+)
+
+func TestMarshalUnmarshalSessionRoundTrip(t *testing.T) {
+	session := auth.NewSession("user@example.com", true)
+
+	data, err := marshalSession(session)
+	if err != nil {
+		t.Fatalf("marshalSession: %v", err)
+	}
+	got, err := unmarshalSession(data)
+	if err != nil {
+		t.Fatalf("unmarshalSession: %v", err)
+	}
+	if got.User() != session.User() || got.IsAuthenticated() != session.IsAuthenticated() {
+		t.Fatalf("got %+v, want a round trip of %+v", got, session)
+	}
+}
+
+func TestUnmarshalSessionRejectsMalformedData(t *testing.T) {
+	if _, err := unmarshalSession([]byte("not json")); err == nil {
+		t.Fatal("expected an error for malformed session data")
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"upspin.googlesource.com/upspin.git/key/keyloader"
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+// Verifier checks whether sig, in its own text encoding, is a valid
+// signature of hash under pubKey. verifyRequest dispatches to a Verifier
+// based on the request's signatureTypeHeader, so each key type owns both
+// its signature encoding and the scheme used to verify it.
+type Verifier interface {
+	Verify(pubKey upspin.PublicKey, hash []byte, sig string) error
+}
+
+// verifiers maps a signatureTypeHeader value to the Verifier that handles
+// it. ECDSA key types (p256, p384, p521) are not registered here; they
+// fall back to ecdsaVerifier in verifyRequest, unchanged from before
+// Verifier existed.
+var verifiers = map[string]Verifier{
+	"ed25519": ed25519Verifier{},
+}
+
+// RegisterVerifier adds or replaces the Verifier used for signatureTypeHeader
+// value keyType. Call it from an init function to add support for a new key type.
+func RegisterVerifier(keyType string, v Verifier) {
+	verifiers[keyType] = v
+}
+
+// ecdsaVerifier implements the original signature encoding: two base-10
+// integers, space-separated.
+type ecdsaVerifier struct{}
+
+var _ Verifier = ecdsaVerifier{}
+
+func (ecdsaVerifier) Verify(pubKey upspin.PublicKey, hash []byte, sig string) error {
+	parsed, _, err := keyloader.ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	ecdsaPubKey, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("key is not an ECDSA public key")
+	}
+	pieces := strings.Fields(sig)
+	if len(pieces) != 2 {
+		return fmt.Errorf("expected two integers in signature, got %d", len(pieces))
+	}
+	var r, s big.Int
+	if _, ok := r.SetString(pieces[0], 10); !ok {
+		return errMissingSignature
+	}
+	if _, ok := s.SetString(pieces[1], 10); !ok {
+		return errMissingSignature
+	}
+	if !ecdsa.Verify(ecdsaPubKey, hash, &r, &s) {
+		return errors.New("ECDSA signature verification failed")
+	}
+	return nil
+}
+
+// ed25519Verifier verifies signatures encoded as the standard base64 of the
+// raw 64-byte Ed25519 signature, avoiding ecdsaVerifier's two-bigint text
+// encoding entirely. Ed25519 is also roughly an order of magnitude faster
+// to verify than P-256 ECDSA, which matters since every Upspin RPC pays for
+// one of these verifications.
+type ed25519Verifier struct{}
+
+var _ Verifier = ed25519Verifier{}
+
+func (ed25519Verifier) Verify(pubKey upspin.PublicKey, hash []byte, sig string) error {
+	pub, _, err := keyloader.ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return errors.New("key is not an Ed25519 public key")
+	}
+	return verifyEd25519(edPub, hash, sig)
+}
+
+// verifyEd25519 checks sig, base64-encoded, as an Ed25519 signature of hash
+// under pub. It is split out from ed25519Verifier.Verify so the actual
+// cryptographic check can be tested directly against a real generated key
+// pair, without going through keyloader.ParsePublicKey.
+func verifyEd25519(pub ed25519.PublicKey, hash []byte, sig string) error {
+	sigBytes, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("malformed Ed25519 signature encoding: %v", err)
+	}
+	if len(sigBytes) != ed25519.SignatureSize {
+		return fmt.Errorf("Ed25519 signature has length %d, want %d", len(sigBytes), ed25519.SignatureSize)
+	}
+	if !ed25519.Verify(pub, hash, sigBytes) {
+		return errors.New("Ed25519 signature verification failed")
+	}
+	return nil
+}
+
+// Ed448 is not wired up: the Go standard library has no crypto/ed448, and
+// pulling in a third-party implementation for one key type isn't justified
+// until a client actually needs it. RegisterVerifier("ed448", ...) is the
+// extension point for whoever does.
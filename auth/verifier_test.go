@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"upspin.googlesource.com/upspin.git/upspin"
+)
+
+func TestVerifyEd25519AcceptsValidSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	hash := []byte("a request hash to sign")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, hash))
+
+	if err := verifyEd25519(pub, hash, sig); err != nil {
+		t.Fatalf("expected a genuine signature to verify: %v", err)
+	}
+}
+
+func TestVerifyEd25519RejectsSignatureFromWrongKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	hash := []byte("a request hash to sign")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(otherPriv, hash))
+
+	if err := verifyEd25519(pub, hash, sig); err == nil {
+		t.Fatal("expected a signature from a different key to be rejected")
+	}
+}
+
+func TestVerifyEd25519RejectsTamperedHash(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("original hash")))
+
+	if err := verifyEd25519(pub, []byte("different hash"), sig); err == nil {
+		t.Fatal("expected a signature to be rejected against a hash it wasn't made for")
+	}
+}
+
+func TestVerifyEd25519RejectsMalformedSignatureEncoding(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	if err := verifyEd25519(pub, []byte("hash"), "not valid base64!!"); err == nil {
+		t.Fatal("expected an error for a malformed signature encoding")
+	}
+}
+
+// fakeVerifier is a minimal Verifier used to test RegisterVerifier's
+// dispatch mechanism in isolation from any particular signature scheme; the
+// actual Ed25519 cryptography is covered separately by the
+// TestVerifyEd25519* tests above.
+type fakeVerifier struct {
+	err error
+}
+
+func (v fakeVerifier) Verify(pubKey upspin.PublicKey, hash []byte, sig string) error {
+	return v.err
+}
+
+func TestRegisterVerifierAddsDispatchEntry(t *testing.T) {
+	RegisterVerifier("fake-type", fakeVerifier{})
+	defer delete(verifiers, "fake-type")
+
+	v, ok := verifiers["fake-type"]
+	if !ok {
+		t.Fatal("RegisterVerifier did not add an entry to verifiers")
+	}
+	if err := v.Verify("key", []byte("hash"), "sig"); err != nil {
+		t.Fatalf("unexpected error from registered verifier: %v", err)
+	}
+}
+
+func TestRegisterVerifierReplacesExistingEntry(t *testing.T) {
+	original := verifiers["ed25519"]
+	defer func() { verifiers["ed25519"] = original }()
+
+	wantErr := &verifierTestError{"replaced"}
+	RegisterVerifier("ed25519", fakeVerifier{err: wantErr})
+
+	if err := verifiers["ed25519"].Verify("key", []byte("hash"), "sig"); err != wantErr {
+		t.Fatalf("got error %v, want the replaced verifier's error", err)
+	}
+}
+
+type verifierTestError struct{ msg string }
+
+func (e *verifierTestError) Error() string { return e.msg }